@@ -0,0 +1,177 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// TestIsForbiddenAddr confirms the address classes a SimpleHTTP redirect
+// must never be allowed to target, including the RFC 5737 documentation
+// range used as a stand-in for a public address elsewhere in this file.
+func TestIsForbiddenAddr(t *testing.T) {
+	forbidden := []string{
+		"127.0.0.1",   // loopback
+		"169.254.1.1", // link-local unicast
+		"0.0.0.0",     // unspecified
+		"10.1.2.3",    // RFC 1918
+		"172.16.0.5",  // RFC 1918
+		"192.168.1.1", // RFC 1918
+		"fc00::1",     // unique local
+	}
+	for _, s := range forbidden {
+		if !isForbiddenAddr(net.ParseIP(s)) {
+			t.Errorf("expected %s to be forbidden", s)
+		}
+	}
+
+	allowed := []string{
+		"203.0.113.10", // RFC 5737 TEST-NET-3, stands in for a public address
+		"8.8.8.8",
+	}
+	for _, s := range allowed {
+		if isForbiddenAddr(net.ParseIP(s)) {
+			t.Errorf("expected %s not to be forbidden", s)
+		}
+	}
+}
+
+// startFakeDNS starts an in-process DNS server that answers A queries for
+// the given hostnames with the given addresses, so fetchViaHTTP's
+// redirect-host lookups can be driven deterministically in a test without a
+// real resolver.
+func startFakeDNS(t *testing.T, answers map[string]net.IP) (*core.DNSResolver, func()) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening for fake DNS: %s", err)
+	}
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		q := r.Question[0]
+		if q.Qtype == dns.TypeA {
+			if ip, ok := answers[strings.TrimSuffix(q.Name, ".")]; ok {
+				rr, _ := dns.NewRR(fmt.Sprintf("%s 0 IN A %s", q.Name, ip.String()))
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		_ = w.WriteMsg(m)
+	})
+	server := &dns.Server{PacketConn: conn, Handler: mux}
+	go func() { _ = server.ActivateAndServe() }()
+	resolver := core.NewDNSResolver(2*time.Second, []string{conn.LocalAddr().String()})
+	return resolver, func() {
+		server.Shutdown()
+		conn.Close()
+	}
+}
+
+// TestFetchViaHTTPRejectsRedirectToForbiddenAddress confirms that a redirect
+// to a host resolving to a private address is rejected even though the
+// first hop resolves to a public-looking one, and that the rejected hop is
+// still recorded in the returned chain for the audit log.
+//
+// This exercises fetchViaHTTP's per-hop isForbiddenAddr check and chain
+// recording with va.HTTPClient overridden (as va/vatest does) to route every
+// dial to a single backend; it does not exercise the hopDialer/pinned-IP
+// path, which only runs when va.HTTPClient is nil and requires dialing a
+// real, distinct listener per resolved address.
+func TestFetchViaHTTPRejectsRedirectToForbiddenAddress(t *testing.T) {
+	resolver, cleanup := startFakeDNS(t, map[string]net.IP{
+		"public.example":  net.ParseIP("203.0.113.10"),
+		"private.example": net.ParseIP("10.1.2.3"),
+	})
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "public.example" {
+			w.Header().Set("Location", "http://private.example/.well-known/acme-challenge/x")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	impl := NewValidationAuthorityImpl()
+	impl.DNSResolver = resolver
+	impl.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, address string) (net.Conn, error) {
+				return net.Dial(network, backend.Listener.Addr().String())
+			},
+		},
+	}
+
+	_, chain, _, err := impl.fetchViaHTTP("public.example", "http://public.example/.well-known/acme-challenge/x", net.ParseIP("203.0.113.10"))
+	if err == nil {
+		t.Fatal("expected fetchViaHTTP to reject a redirect to a private address")
+	}
+	if !strings.Contains(err.Error(), "private/loopback/link-local") {
+		t.Errorf("expected a forbidden-address error, got: %s", err)
+	}
+	if len(chain) != 2 || chain[1] != "http://private.example/.well-known/acme-challenge/x" {
+		t.Errorf("expected the redirect chain to record both hops, got: %v", chain)
+	}
+}
+
+// TestFetchViaHTTPFollowsAllowedRedirect confirms a redirect chain between
+// two public-looking addresses is followed to completion and fully
+// recorded.
+func TestFetchViaHTTPFollowsAllowedRedirect(t *testing.T) {
+	resolver, cleanup := startFakeDNS(t, map[string]net.IP{
+		"public1.example": net.ParseIP("203.0.113.10"),
+		"public2.example": net.ParseIP("203.0.113.20"),
+	})
+	defer cleanup()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "public1.example" {
+			w.Header().Set("Location", "http://public2.example/.well-known/acme-challenge/x")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	impl := NewValidationAuthorityImpl()
+	impl.DNSResolver = resolver
+	impl.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, address string) (net.Conn, error) {
+				return net.Dial(network, backend.Listener.Addr().String())
+			},
+		},
+	}
+
+	resp, chain, resolved, err := impl.fetchViaHTTP("public1.example", "http://public1.example/.well-known/acme-challenge/x", net.ParseIP("203.0.113.10"))
+	if err != nil {
+		t.Fatalf("fetchViaHTTP: %s", err)
+	}
+	defer resp.Body.Close()
+	if len(chain) != 2 {
+		t.Errorf("expected a two-hop chain, got: %v", chain)
+	}
+	if _, ok := resolved["public1.example"]; !ok {
+		t.Errorf("expected public1.example to be recorded as resolved, got: %v", resolved)
+	}
+	if _, ok := resolved["public2.example"]; !ok {
+		t.Errorf("expected public2.example to be recorded as resolved, got: %v", resolved)
+	}
+}
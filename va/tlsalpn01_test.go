@@ -0,0 +1,122 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/va/vatest"
+)
+
+// idPeAcmeIdentifier is RFC 8737's id-pe-acmeIdentifier OID, duplicated
+// here (rather than imported, since it's unexported in package va) to
+// build a validation certificate the same way a real ACME client would.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// tlsALPN01Cert builds a self-signed certificate of the shape a client
+// must present to satisfy a TLS-ALPN-01 challenge: a single dNSName SAN
+// matching identifier, and a critical extension carrying the SHA-256
+// digest of the expected key authorization.
+func tlsALPN01Cert(t *testing.T, identifier, keyAuthorization string) *tls.Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+
+	digest := sha256.Sum256([]byte(keyAuthorization))
+	extValue, err := asn1.Marshal(digest[:])
+	if err != nil {
+		t.Fatalf("marshaling extension value: %s", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: identifier},
+		DNSNames:     []string{identifier},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: idPeAcmeIdentifier, Critical: true, Value: extValue},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %s", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// TestValidateTLSALPN01 drives a TLS-ALPN-01 challenge through the
+// va/vatest harness end-to-end: real DNS resolution, a real TLS
+// handshake negotiating acme-tls/1, and real certificate parsing in
+// validateTLSALPN01, to confirm the validator accepts a correctly-formed
+// response.
+func TestValidateTLSALPN01(t *testing.T) {
+	const identifier = "example.com"
+	const token = "test-token-0123456789abcdefghij"
+	accountPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating account key: %s", err)
+	}
+	accountKey := jose.JsonWebKey{Key: &accountPrivateKey.PublicKey}
+
+	keyAuthorization, err := core.KeyAuthorization(token, accountKey)
+	if err != nil {
+		t.Fatalf("computing key authorization: %s", err)
+	}
+	cert := tlsALPN01Cert(t, identifier, keyAuthorization)
+
+	s, err := vatest.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}), func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cert, nil
+	})
+	if err != nil {
+		t.Fatalf("vatest.New: %s", err)
+	}
+	defer s.Close()
+
+	authz := core.Authorization{
+		ID:             "test-authz",
+		RegistrationID: 1,
+		Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: identifier},
+		Challenges: []core.Challenge{
+			{Type: core.ChallengeTypeTLSALPN01, Token: token, Status: core.StatusPending},
+		},
+	}
+
+	if err := s.VA.UpdateValidations(authz, 0, accountKey); err != nil {
+		t.Fatalf("UpdateValidations: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Authorizations()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reported := s.Authorizations()
+	if len(reported) != 1 {
+		t.Fatalf("expected exactly one OnValidationUpdate call, got %d", len(reported))
+	}
+	challenge := reported[0].Authz.Challenges[0]
+	if challenge.Status != core.StatusValid {
+		t.Errorf("expected TLS-ALPN-01 challenge to be valid, got %s (error: %v)", challenge.Status, challenge.Error)
+	}
+}
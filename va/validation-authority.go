@@ -6,56 +6,553 @@
 package va
 
 import (
+	"context"
 	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/rpc"
 	"net/url"
 	"strings"
 	"time"
 
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
 
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/policy"
 )
 
+// DialTLSFunc dials addr and returns a TLS connection negotiated with
+// config, mirroring the signature of tls.DialWithDialer minus the dialer
+// itself. It is the injection point used by validateDvsni and
+// validateTLSALPN01 to reach a test harness instead of the real network.
+type DialTLSFunc func(network, addr string, config *tls.Config) (*tls.Conn, error)
+
 // ValidationAuthorityImpl represents a VA
 type ValidationAuthorityImpl struct {
 	RA           core.RegistrationAuthority
 	log          *blog.AuditLogger
 	DNSResolver  *core.DNSResolver
 	IssuerDomain string
-	TestMode     bool
+	// HTTPClient, if set, is used for SimpleHTTP/HTTP-01 validation requests
+	// in place of the VA's default client. Tests use this to point
+	// validation at an in-process harness instead of the real network.
+	HTTPClient *http.Client
+	// DialTLS, if set, is used to establish the TLS connection made during
+	// DVSNI and TLS-ALPN-01 validation, in place of dialing the identifier
+	// directly on port 443.
+	DialTLS DialTLSFunc
+	// MaxHTTPRedirects bounds the number of redirects validateSimpleHTTP
+	// will follow. Zero means defaultMaxHTTPRedirects.
+	MaxHTTPRedirects int
+	// AddressQuorum is the minimum number of an identifier's A/AAAA
+	// addresses that must independently verify a challenge for it to be
+	// considered valid. Zero (the default) requires every address to
+	// verify, closing the loophole where only one round-robin backend is
+	// compromised.
+	AddressQuorum int
+	// RemoteVAs are geographically diverse secondary VAs consulted, over
+	// RPC, after a challenge validates locally. They guard against a
+	// local BGP hijack fooling this VA alone.
+	RemoteVAs []RemoteVA
+	// RemoteQuorum is how many of RemoteVAs must agree a challenge is
+	// valid, e.g. 2 for a 2-of-3 quorum. Zero (the default) requires all
+	// of them to agree.
+	RemoteQuorum int
+	// RemoteVATimeout bounds how long confirmWithRemotePerspectives waits
+	// for any single RemoteVA before counting it as a non-agreeing
+	// perspective. Zero means defaultRemoteVATimeout.
+	RemoteVATimeout time.Duration
+	solvers         map[string]ChallengeSolver
+}
+
+// defaultRemoteVATimeout is how long confirmWithRemotePerspectives waits
+// for a RemoteVA when ValidationAuthorityImpl.RemoteVATimeout is unset.
+const defaultRemoteVATimeout = 30 * time.Second
+
+// remoteVATimeout returns how long to wait for a single RemoteVA, given
+// va.RemoteVATimeout.
+func (va *ValidationAuthorityImpl) remoteVATimeout() time.Duration {
+	if va.RemoteVATimeout > 0 {
+		return va.RemoteVATimeout
+	}
+	return defaultRemoteVATimeout
+}
+
+// RemoteVA is a secondary VA reachable over RPC, consulted from a
+// different network vantage point to confirm a challenge that has
+// already validated locally. PerformValidation must respect ctx's
+// deadline/cancellation so a single unreachable remote can't stall
+// confirmWithRemotePerspectives indefinitely.
+type RemoteVA interface {
+	// Perspective identifies this remote VA's vantage point, e.g. its
+	// datacenter or region, for inclusion in the audit log.
+	Perspective() string
+	// PerformValidation asks the remote VA to independently validate the
+	// given challenge, mirroring the signature of ChallengeSolver.Solve.
+	PerformValidation(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error)
+}
+
+// PerspectiveResult records one RemoteVA's verdict on a challenge that has
+// already validated from the primary VA's vantage point.
+type PerspectiveResult struct {
+	Perspective string
+	Valid       bool
+	Latency     time.Duration
+	Error       string `json:",omitempty"`
+}
+
+// RemoteValidationArgs and RemoteValidationReply are rpcRemoteVA's net/rpc
+// request/response pair. Their fields are exported so the gob encoder used
+// by net/rpc can see them.
+type RemoteValidationArgs struct {
+	Identifier core.AcmeIdentifier
+	Challenge  core.Challenge
+	AccountKey jose.JsonWebKey
+}
+
+// RemoteValidationReply is rpcRemoteVA's net/rpc reply.
+type RemoteValidationReply struct {
+	Challenge core.Challenge
+}
+
+// rpcRemoteVA is a RemoteVA that calls a remote VA's PerformValidation
+// method over net/rpc wrapped in mutual TLS, dialing fresh for every call
+// so a remote that's temporarily down doesn't wedge a long-lived
+// connection.
+type rpcRemoteVA struct {
+	perspective string
+	network     string
+	addr        string
+	dialTimeout time.Duration
+	tlsConfig   *tls.Config
+}
+
+// NewRPCRemoteVA returns a RemoteVA that reaches a remote VA's
+// "ValidationAuthority.PerformValidation" net/rpc method at addr (e.g.
+// "vpn-fra.example.com:8090"), identifying itself as perspective in audit
+// logs and PerspectiveResults. tlsConfig must be configured for mutual
+// authentication (a client certificate plus a RootCAs pool that only trusts
+// the remote's issuer): this perspective only adds protection against a
+// local BGP hijack if an attacker capable of that hijack cannot also
+// impersonate either end of the channel, so the connection is never made in
+// cleartext.
+func NewRPCRemoteVA(perspective, network, addr string, tlsConfig *tls.Config) RemoteVA {
+	return &rpcRemoteVA{perspective: perspective, network: network, addr: addr, dialTimeout: 5 * time.Second, tlsConfig: tlsConfig}
+}
+
+func (r *rpcRemoteVA) Perspective() string { return r.perspective }
+
+func (r *rpcRemoteVA) PerformValidation(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	rawConn, err := net.DialTimeout(r.network, r.addr, r.dialTimeout)
+	if err != nil {
+		return challenge, err
+	}
+	conn := tls.Client(rawConn, r.tlsConfig)
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := conn.Handshake(); err != nil {
+		return challenge, err
+	}
+
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	var reply RemoteValidationReply
+	call := client.Go("ValidationAuthority.PerformValidation", &RemoteValidationArgs{
+		Identifier: identifier,
+		Challenge:  challenge,
+		AccountKey: accountKey,
+	}, &reply, nil)
+
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return challenge, call.Error
+		}
+		return reply.Challenge, nil
+	case <-ctx.Done():
+		return challenge, ctx.Err()
+	}
+}
+
+// remoteQuorum returns how many of va.RemoteVAs must agree a challenge is
+// valid, given va.RemoteQuorum.
+func (va *ValidationAuthorityImpl) remoteQuorum() int {
+	if va.RemoteQuorum > 0 && va.RemoteQuorum <= len(va.RemoteVAs) {
+		return va.RemoteQuorum
+	}
+	return len(va.RemoteVAs)
+}
+
+// confirmWithRemotePerspectives fans the already-locally-valid challenge
+// out to every configured RemoteVA in parallel and requires va.remoteQuorum()
+// of them to agree before leaving challenge as core.StatusValid; otherwise
+// it marks the challenge invalid, mitigating a local BGP hijack of the
+// primary VA's view of the network. It always returns the individual
+// per-remote results for the audit log.
+func (va *ValidationAuthorityImpl) confirmWithRemotePerspectives(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, []PerspectiveResult) {
+	if len(va.RemoteVAs) == 0 {
+		return challenge, nil
+	}
+
+	results := make(chan PerspectiveResult, len(va.RemoteVAs))
+	for _, remote := range va.RemoteVAs {
+		go func(remote RemoteVA) {
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), va.remoteVATimeout())
+			defer cancel()
+			remoteChallenge, err := remote.PerformValidation(ctx, identifier, challenge, accountKey)
+			result := PerspectiveResult{
+				Perspective: remote.Perspective(),
+				Latency:     time.Since(start),
+				Valid:       err == nil && remoteChallenge.Status == core.StatusValid,
+			}
+			if err != nil {
+				result.Error = err.Error()
+			} else if remoteChallenge.Error != nil {
+				result.Error = remoteChallenge.Error.Detail
+			}
+			results <- result
+		}(remote)
+	}
+
+	perspectiveResults := make([]PerspectiveResult, 0, len(va.RemoteVAs))
+	agree := 0
+	for i := 0; i < len(va.RemoteVAs); i++ {
+		result := <-results
+		perspectiveResults = append(perspectiveResults, result)
+		if result.Valid {
+			agree++
+		}
+	}
+
+	if agree < va.remoteQuorum() {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type: core.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Only %d/%d remote perspectives could validate this challenge, quorum is %d",
+				agree, len(va.RemoteVAs), va.remoteQuorum()),
+		}
+	}
+
+	return challenge, perspectiveResults
+}
+
+// addressQuorum returns how many of an identifier's total addresses must
+// verify a challenge for it to pass, given va.AddressQuorum.
+func (va *ValidationAuthorityImpl) addressQuorum(total int) int {
+	if va.AddressQuorum > 0 && va.AddressQuorum <= total {
+		return va.AddressQuorum
+	}
+	return total
+}
+
+// addressValidationEvent records, per resolved address, whether a challenge
+// verified ("valid") or the reason it did not, so operators can diagnose a
+// compromised backend behind a multi-A-record host.
+type addressValidationEvent struct {
+	Identifier    core.AcmeIdentifier
+	ChallengeType string
+	Results       map[string]string
+}
+
+// defaultMaxHTTPRedirects is the number of redirect hops validateSimpleHTTP
+// will follow when ValidationAuthorityImpl.MaxHTTPRedirects is unset.
+const defaultMaxHTTPRedirects = 10
+
+func (va *ValidationAuthorityImpl) maxHTTPRedirects() int {
+	if va.MaxHTTPRedirects > 0 {
+		return va.MaxHTTPRedirects
+	}
+	return defaultMaxHTTPRedirects
+}
+
+// privateNetworks are the address ranges a SimpleHTTP redirect must never
+// be allowed to target, to stop a validated domain from bouncing validation
+// to an internal service.
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("fc00::/7"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// isForbiddenAddr reports whether ip is a loopback, link-local, or private
+// address that a SimpleHTTP redirect must not be allowed to target.
+func isForbiddenAddr(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, ipNet := range privateNetworks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectAuditEvent captures the chain of URLs followed while validating a
+// SimpleHTTP/HTTP-01 challenge, and the addresses resolved for each hop, so
+// operators can debug multi-A-record hosts and http-to-https redirects.
+type redirectAuditEvent struct {
+	Identifier        core.AcmeIdentifier
+	Chain             []string
+	ResolvedAddresses map[string][]string
+}
+
+// fetchViaHTTP follows up to va.maxHTTPRedirects() redirects starting at
+// startURL, sending hostHeader as the initial Host header and connecting
+// the first hop to addr (the specific A/AAAA record under test) rather
+// than letting the transport resolve it. Each hop's target must be an
+// http(s) URL whose host resolves (re-applying the DNSSEC check already
+// performed on the original identifier) to addresses that are not
+// private, loopback, or link-local. It returns the final response along
+// with the full chain of URLs visited and the addresses resolved for each
+// hop, for inclusion in the audit log.
+func (va *ValidationAuthorityImpl) fetchViaHTTP(hostHeader, startURL string, addr net.IP) (*http.Response, []string, map[string][]string, error) {
+	// hopDialer pins every connection the client makes to whatever address
+	// was validated for the hop currently in flight (set below, before each
+	// client.Do), rather than letting the transport re-resolve the host at
+	// connect time. Re-resolving independently of the validated address
+	// would let a host pass the lookup with a public address and then
+	// answer the real connection with a private/loopback one (DNS
+	// rebinding), defeating the isForbiddenAddr check entirely.
+	var pinned net.IP
+	hopDialer := func(network, address string) (net.Conn, error) {
+		if pinned != nil {
+			_, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			address = net.JoinHostPort(pinned.String(), port)
+		}
+		return net.Dial(network, address)
+	}
+
+	var client http.Client
+	if va.HTTPClient != nil {
+		client = *va.HTTPClient
+	} else {
+		client = http.Client{
+			Transport: &http.Transport{
+				// We are talking to a client that does not yet have a
+				// certificate, so we accept a temporary, invalid one.
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				// We don't expect to make multiple requests to a client, so
+				// close connection immediately.
+				DisableKeepAlives: true,
+				Dial:              hopDialer,
+			},
+			Timeout: 5 * time.Second,
+		}
+	}
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	var chain []string
+	resolved := make(map[string][]string)
+	currentURL := startURL
+	currentHost := hostHeader
+	pinned = addr
+
+	for i := 0; ; i++ {
+		chain = append(chain, currentURL)
+
+		parsedURL, err := url.Parse(currentURL)
+		if err != nil {
+			return nil, chain, resolved, fmt.Errorf("Invalid redirect target %s: %s", currentURL, err)
+		}
+		if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+			return nil, chain, resolved, fmt.Errorf("Redirect to non-http(s) URL %s", currentURL)
+		}
+
+		host := parsedURL.Host
+		if h, _, splitErr := net.SplitHostPort(host); splitErr == nil {
+			host = h
+		}
+		_, addrs, lookupErr := va.DNSResolver.LookupHost(host)
+		if lookupErr != nil {
+			return nil, chain, resolved, lookupErr
+		}
+		if len(addrs) == 0 {
+			return nil, chain, resolved, fmt.Errorf("No addresses found for redirect host %s", host)
+		}
+		addrStrs := make([]string, len(addrs))
+		for j, addr := range addrs {
+			addrStrs[j] = addr.String()
+			if isForbiddenAddr(addr) {
+				return nil, chain, resolved, fmt.Errorf("Redirect to private/loopback/link-local address %s", addr)
+			}
+		}
+		resolved[host] = addrStrs
+
+		// Pin this hop's connection to the address that was just
+		// validated above. The first hop keeps using the specific
+		// address the caller asked us to validate; later hops pin to
+		// the first resolved address for the new host.
+		if i > 0 {
+			pinned = addrs[0]
+		}
+
+		httpRequest, err := http.NewRequest("GET", currentURL, nil)
+		if err != nil {
+			return nil, chain, resolved, err
+		}
+		httpRequest.Host = currentHost
+
+		resp, err := client.Do(httpRequest)
+		if err != nil {
+			return nil, chain, resolved, err
+		}
+
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+			return resp, chain, resolved, nil
+		}
+		resp.Body.Close()
+
+		if i+1 >= va.maxHTTPRedirects() {
+			return nil, chain, resolved, fmt.Errorf("Too many redirects")
+		}
+
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return nil, chain, resolved, fmt.Errorf("Redirect with no Location header")
+		}
+		nextURL, err := parsedURL.Parse(location)
+		if err != nil {
+			return nil, chain, resolved, fmt.Errorf("Invalid redirect Location %s: %s", location, err)
+		}
+		currentURL = nextURL.String()
+		currentHost = nextURL.Host
+	}
 }
 
-// NewValidationAuthorityImpl constructs a new VA, and may place it
-// into Test Mode (tm)
-func NewValidationAuthorityImpl(tm bool) ValidationAuthorityImpl {
+// NewValidationAuthorityImpl constructs a new VA. It returns a pointer so
+// that callers who set fields after construction (DNSResolver, RA,
+// HTTPClient, DialTLS, etc., following the pattern used throughout this
+// codebase and by va/vatest) are mutating the same struct the registered
+// solvers close over, rather than a copy.
+func NewValidationAuthorityImpl() *ValidationAuthorityImpl {
 	logger := blog.GetAuditLogger()
 	logger.Notice("Validation Authority Starting")
-	return ValidationAuthorityImpl{log: logger, TestMode: tm}
+	va := &ValidationAuthorityImpl{log: logger, solvers: make(map[string]ChallengeSolver)}
+	va.RegisterSolver(simpleHTTPSolver{va: va})
+	va.RegisterSolver(dvsniSolver{va: va})
+	va.RegisterSolver(dnsSolver{va: va})
+	va.RegisterSolver(tlsALPN01Solver{va: va})
+	return va
+}
+
+// dialTLS dials addr using the VA's injected DialTLS hook, or a direct
+// tls.Dial if none was configured.
+func (va *ValidationAuthorityImpl) dialTLS(network, addr string, config *tls.Config) (*tls.Conn, error) {
+	if va.DialTLS != nil {
+		return va.DialTLS(network, addr, config)
+	}
+	return tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, network, addr, config)
+}
+
+// ChallengeSolver is implemented by types that know how to validate a single
+// ACME challenge type. Operators and tests can register additional solvers
+// via VA.RegisterSolver without needing to modify the validate() dispatch.
+type ChallengeSolver interface {
+	// Type returns the ACME challenge type this solver handles, e.g.
+	// core.ChallengeTypeSimpleHTTP.
+	Type() string
+	// Solve attempts to validate the given challenge for identifier, using
+	// accountKey to verify any JWS-signed response.
+	Solve(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error)
+}
+
+// RegisterSolver adds (or replaces) the ChallengeSolver responsible for
+// solver.Type(), allowing operators and tests to inject alternate or mock
+// solvers without editing the VA's dispatch logic.
+func (va *ValidationAuthorityImpl) RegisterSolver(solver ChallengeSolver) {
+	if va.solvers == nil {
+		va.solvers = make(map[string]ChallengeSolver)
+	}
+	va.solvers[solver.Type()] = solver
+}
+
+type simpleHTTPSolver struct {
+	va *ValidationAuthorityImpl
+}
+
+func (s simpleHTTPSolver) Type() string { return core.ChallengeTypeSimpleHTTP }
+
+func (s simpleHTTPSolver) Solve(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	return s.va.validateSimpleHTTP(identifier, challenge, accountKey)
+}
+
+type dvsniSolver struct {
+	va *ValidationAuthorityImpl
+}
+
+func (s dvsniSolver) Type() string { return core.ChallengeTypeDVSNI }
+
+func (s dvsniSolver) Solve(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	return s.va.validateDvsni(identifier, challenge, accountKey)
+}
+
+type dnsSolver struct {
+	va *ValidationAuthorityImpl
+}
+
+func (s dnsSolver) Type() string { return core.ChallengeTypeDNS }
+
+func (s dnsSolver) Solve(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	return s.va.validateDNS(identifier, challenge)
+}
+
+// tlsALPN01Solver dispatches to validateTLSALPN01. Note that solve() gates
+// every challenge on challenge.IsSane(true) before reaching this solver;
+// that check, and the core.ChallengeTypeTLSALPN01 constant itself, live in
+// the core package, not here, so they must already recognize tls-alpn-01
+// or this solver is never reached.
+type tlsALPN01Solver struct {
+	va *ValidationAuthorityImpl
+}
+
+func (s tlsALPN01Solver) Type() string { return core.ChallengeTypeTLSALPN01 }
+
+func (s tlsALPN01Solver) Solve(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	return s.va.validateTLSALPN01(identifier, challenge, accountKey)
 }
 
 // Used for audit logging
 type verificationRequestEvent struct {
-	ID           string         `json:",omitempty"`
-	Requester    int64          `json:",omitempty"`
-	Challenge    core.Challenge `json:",omitempty"`
-	RequestTime  time.Time      `json:",omitempty"`
-	ResponseTime time.Time      `json:",omitempty"`
-	Error        string         `json:",omitempty"`
+	ID                 string              `json:",omitempty"`
+	Requester          int64               `json:",omitempty"`
+	Challenge          core.Challenge      `json:",omitempty"`
+	RequestTime        time.Time           `json:",omitempty"`
+	ResponseTime       time.Time           `json:",omitempty"`
+	Error              string              `json:",omitempty"`
+	PerspectiveResults []PerspectiveResult `json:",omitempty"`
 }
 
 // Validation methods
 
-func (va ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+func (va *ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
 	challenge := input
 
 	if len(challenge.Path) == 0 {
@@ -80,8 +577,9 @@ func (va ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentif
 	}
 	hostName := identifier.Value
 
-	// Check for DNSSEC failures for A/AAAA records
-	_, _, err := va.DNSResolver.LookupHost(hostName)
+	// Check for DNSSEC failures, and enumerate every A/AAAA address for
+	// the identifier.
+	_, addrs, err := va.DNSResolver.LookupHost(hostName)
 	if err != nil {
 		if dnssecErr, ok := err.(core.DNSSECError); ok {
 			challenge.Error = &core.ProblemDetails{
@@ -105,103 +603,108 @@ func (va ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentif
 	} else {
 		scheme = "http"
 	}
-	if va.TestMode {
-		hostName = "localhost:5001"
-		scheme = "http"
-	}
 
 	url := fmt.Sprintf("%s://%s/.well-known/acme-challenge/%s", scheme, hostName, challenge.Path)
 
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 	va.log.Audit(fmt.Sprintf("Attempting to validate Simple%s for %s", strings.ToUpper(scheme), url))
-	httpRequest, err := http.NewRequest("GET", url, nil)
-	if err != nil {
+
+	if len(addrs) == 0 {
+		challenge.Status = core.StatusInvalid
 		challenge.Error = &core.ProblemDetails{
-			Type:   core.MalformedProblem,
-			Detail: "URL provided for SimpleHTTP was invalid",
+			Type:   core.ServerInternalProblem,
+			Detail: fmt.Sprintf("No addresses found for %s", hostName),
 		}
-		va.log.Debug(fmt.Sprintf("SimpleHTTP [%s] HTTP failure: %s", identifier, err))
-		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return challenge, challenge.Error
 	}
 
-	httpRequest.Host = hostName
-	tr := &http.Transport{
-		// We are talking to a client that does not yet have a certificate,
-		// so we accept a temporary, invalid one.
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		// We don't expect to make multiple requests to a client, so close
-		// connection immediately.
-		DisableKeepAlives: true,
-	}
-	client := http.Client{
-		Transport: tr,
-		Timeout:   5 * time.Second,
+	// Dial every resolved address explicitly and require each one (or a
+	// configured quorum) to independently serve a valid response, closing
+	// the well-known DV loophole where only one round-robin backend is
+	// compromised.
+	addressResults := make(map[string]string, len(addrs))
+	successes := 0
+	var lastErr error
+	for _, addr := range addrs {
+		verifyErr := va.verifySimpleHTTPAddr(identifier, challenge, accountKey, url, hostName, addr)
+		if verifyErr != nil {
+			addressResults[addr.String()] = verifyErr.Error()
+			lastErr = verifyErr
+			continue
+		}
+		addressResults[addr.String()] = "valid"
+		successes++
 	}
-	httpResponse, err := client.Do(httpRequest)
 
-	if err != nil {
+	va.log.AuditObject("SimpleHTTP per-address results", addressValidationEvent{
+		Identifier:    identifier,
+		ChallengeType: core.ChallengeTypeSimpleHTTP,
+		Results:       addressResults,
+	})
+
+	if successes < va.addressQuorum(len(addrs)) {
 		challenge.Status = core.StatusInvalid
 		challenge.Error = &core.ProblemDetails{
-			Type:   parseHTTPConnError(err),
-			Detail: fmt.Sprintf("Could not connect to %s", url),
+			Type:   parseHTTPConnError(lastErr),
+			Detail: fmt.Sprintf("Validation failed for one or more addresses of %s: %s", hostName, lastErr.Error()),
 		}
-		va.log.Debug(strings.Join([]string{challenge.Error.Error(), err.Error()}, ": "))
+		return challenge, challenge.Error
+	}
+
+	challenge.Status = core.StatusValid
+	return challenge, nil
+}
+
+// verifySimpleHTTPAddr fetches url (following redirects) over a connection
+// pinned to addr, and checks that the response is a validly-signed JWS
+// attesting to the expected challenge fields.
+func (va *ValidationAuthorityImpl) verifySimpleHTTPAddr(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey, url, hostName string, addr net.IP) error {
+	httpResponse, chain, resolvedAddrs, err := va.fetchViaHTTP(hostName, url, addr)
+	va.log.AuditObject("SimpleHTTP redirect chain", redirectAuditEvent{
+		Identifier:        identifier,
+		Chain:             chain,
+		ResolvedAddresses: resolvedAddrs,
+	})
+	if err != nil {
+		return fmt.Errorf("Could not connect to %s: %s", url, err)
 	}
+	defer httpResponse.Body.Close()
 
 	if httpResponse.StatusCode != 200 {
-		challenge.Status = core.StatusInvalid
-		challenge.Error = &core.ProblemDetails{
-			Type: core.UnauthorizedProblem,
-			Detail: fmt.Sprintf("Invalid response from %s: %d",
-				url, httpResponse.StatusCode),
-		}
-		err = challenge.Error	
+		return fmt.Errorf("Invalid response from %s: %d", url, httpResponse.StatusCode)
 	}
 
-	// Read body & test
-	body, readErr := ioutil.ReadAll(httpResponse.Body)
-	if readErr != nil {
-		challenge.Status = core.StatusInvalid
-		return challenge, readErr
+	body, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
 	}
 
-	// Parse and verify JWS
+	return va.verifySimpleHTTPResponse(challenge, accountKey, body)
+}
+
+// verifySimpleHTTPResponse checks that body is a validly-signed JWS whose
+// payload attests to the expected type/token/path/tls fields of challenge.
+func (va *ValidationAuthorityImpl) verifySimpleHTTPResponse(challenge core.Challenge, accountKey jose.JsonWebKey, body []byte) error {
 	parsedJws, err := jose.ParseSigned(string(body))
 	if err != nil {
-		err = fmt.Errorf("Validation response failed to parse as JWS: %s", err.Error())
-		va.log.Debug(err.Error())
-		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return fmt.Errorf("Validation response failed to parse as JWS: %s", err.Error())
 	}
 
 	if len(parsedJws.Signatures) > 1 {
-		err = fmt.Errorf("Too many signatures on validation JWS")
-		va.log.Debug(err.Error())
-		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return fmt.Errorf("Too many signatures on validation JWS")
 	}
 	if len(parsedJws.Signatures) == 0 {
-		err = fmt.Errorf("Validation JWS not signed")
-		va.log.Debug(err.Error())
-		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return fmt.Errorf("Validation JWS not signed")
 	}
 
 	key := parsedJws.Signatures[0].Header.JsonWebKey
 	if !core.KeyDigestEquals(key, accountKey) {
-		err = fmt.Errorf("Response JWS signed with improper key: %s", err.Error())
-		va.log.Debug(err.Error())
-		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return fmt.Errorf("Response JWS signed with improper key")
 	}
 
 	payload, _, err := parsedJws.Verify(key)
 	if err != nil {
-		err = fmt.Errorf("Validation response failed to verify: %s", err.Error())
-		va.log.Debug(err.Error())
-		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return fmt.Errorf("Validation response failed to verify: %s", err.Error())
 	}
 
 	// Check that JWS body is as expected
@@ -211,18 +714,11 @@ func (va ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentif
 	// * "tls" == challenge.tls
 	va.log.Debug(fmt.Sprintf("Validation response payload: %s", string(payload)))
 	var parsedResponse map[string]interface{}
-	err = json.Unmarshal(payload, &parsedResponse)
-	if err != nil {
-		err = fmt.Errorf("Validation payload failed to parse as JSON: %s", err.Error())
-		va.log.Debug(err.Error())
-		challenge.Status = core.StatusInvalid
-		return challenge, err
+	if err := json.Unmarshal(payload, &parsedResponse); err != nil {
+		return fmt.Errorf("Validation payload failed to parse as JSON: %s", err.Error())
 	}
 	if len(parsedResponse) != 4 {
-		err = fmt.Errorf("Validation payload did not have all fields")
-		va.log.Debug(err.Error())
-		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return fmt.Errorf("Validation payload did not have all fields")
 	}
 	typePassed := false
 	tokenPassed := false
@@ -244,24 +740,18 @@ func (va ValidationAuthorityImpl) validateSimpleHTTP(identifier core.AcmeIdentif
 			tlsValue := challenge.TLS != nil && *challenge.TLS
 			tlsPassed = ok && castValue == tlsValue
 		default:
-			err = fmt.Errorf("Validation payload did not have all fields")
-			challenge.Status = core.StatusInvalid
-			return challenge, err
+			return fmt.Errorf("Validation payload did not have all fields")
 		}
 	}
 	if !typePassed || !tokenPassed || !pathPassed || !tlsPassed {
-		err = fmt.Errorf("Validation contents were not correct: type=%s token=%s path=%s tls=%s",
+		return fmt.Errorf("Validation contents were not correct: type=%t token=%t path=%t tls=%t",
 			typePassed, tokenPassed, pathPassed, tlsPassed)
-		va.log.Debug(err.Error())
-		challenge.Status = core.StatusInvalid
-		return challenge, err
 	}
 
-	challenge.Status = core.StatusValid
-	return challenge, nil
+	return nil
 }
 
-func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+func (va *ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
 	challenge := input
 
 	if identifier.Type != "dns" {
@@ -302,8 +792,9 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 	z := sha256.Sum256(RS)
 	zName := fmt.Sprintf("%064x.acme.invalid", z)
 
-	// Check for DNSSEC failures for A/AAAA records
-	_, _, err = va.DNSResolver.LookupHost(identifier.Value)
+	// Check for DNSSEC failures, and enumerate every A/AAAA address for
+	// the identifier.
+	_, addrs, err := va.DNSResolver.LookupHost(identifier.Value)
 	if err != nil {
 		if dnssecErr, ok := err.(core.DNSSECError); ok {
 			challenge.Error = &core.ProblemDetails{
@@ -321,52 +812,240 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 		return challenge, challenge.Error
 	}
 
-	// Make a connection with SNI = nonceName
-	hostPort := identifier.Value + ":443"
-	if va.TestMode {
-		hostPort = "localhost:5001"
+	if len(addrs) == 0 {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.ServerInternalProblem,
+			Detail: fmt.Sprintf("No addresses found for %s", identifier.Value),
+		}
+		return challenge, challenge.Error
 	}
+
+	// Make a connection with SNI = nonceName to every resolved address (or
+	// a configured quorum), closing the well-known DV loophole where only
+	// one round-robin backend is compromised, and exercising IPv6 paths.
+	addressResults := make(map[string]string, len(addrs))
+	successes := 0
+	var lastErr error
+	for _, addr := range addrs {
+		if verifyErr := va.verifyDvsniAddr(identifier, zName, nonceName, addr); verifyErr != nil {
+			addressResults[addr.String()] = verifyErr.Error()
+			lastErr = verifyErr
+			continue
+		}
+		addressResults[addr.String()] = "valid"
+		successes++
+	}
+
+	va.log.AuditObject("DVSNI per-address results", addressValidationEvent{
+		Identifier:    identifier,
+		ChallengeType: core.ChallengeTypeDVSNI,
+		Results:       addressResults,
+	})
+
+	if successes < va.addressQuorum(len(addrs)) {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   parseHTTPConnError(lastErr),
+			Detail: fmt.Sprintf("DVSNI validation failed for one or more addresses of %s: %s", identifier.Value, lastErr.Error()),
+		}
+		return challenge, challenge.Error
+	}
+
+	challenge.Status = core.StatusValid
+	return challenge, nil
+}
+
+// verifyDvsniAddr dials addr on port 443 with SNI set to nonceName, and
+// checks that zName appears as a dNSName SAN in the certificate presented.
+func (va *ValidationAuthorityImpl) verifyDvsniAddr(identifier core.AcmeIdentifier, zName, nonceName string, addr net.IP) error {
+	hostPort := net.JoinHostPort(addr.String(), "443")
 	va.log.Notice(fmt.Sprintf("DVSNI [%s] Attempting to validate DVSNI for %s %s",
 		identifier, hostPort, zName))
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", hostPort, &tls.Config{
+	conn, err := va.dialTLS("tcp", hostPort, &tls.Config{
 		ServerName:         nonceName,
 		InsecureSkipVerify: true,
 	})
-
 	if err != nil {
-		challenge.Status = core.StatusInvalid
-		challenge.Error = &core.ProblemDetails{
-			Type:   parseHTTPConnError(err),
-			Detail: "Failed to connect to host for DVSNI challenge",
-		}
-		va.log.Debug(fmt.Sprintf("DVSNI [%s] TLS Connection failure: %s", identifier, err))
-		return challenge, err
+		return err
 	}
 	defer conn.Close()
 
 	// Check that zName is a dNSName SAN in the server's certificate
 	certs := conn.ConnectionState().PeerCertificates
 	if len(certs) == 0 {
+		return fmt.Errorf("No certs presented for DVSNI challenge")
+	}
+	for _, name := range certs[0].DNSNames {
+		if subtle.ConstantTimeCompare([]byte(name), []byte(zName)) == 1 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Correct zName not found for DVSNI challenge")
+}
+
+// ACMETLS1Protocol is the ALPN protocol ID for the TLS-ALPN-01 challenge,
+// as defined by draft-ietf-acme-tls-alpn.
+const ACMETLS1Protocol = "acme-tls/1"
+
+// idPeAcmeIdentifier is the OID of the acmeIdentifier X.509 extension that
+// must be carried by the self-signed certificate presented during a
+// TLS-ALPN-01 challenge.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+func (va *ValidationAuthorityImpl) validateTLSALPN01(identifier core.AcmeIdentifier, input core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS {
 		challenge.Error = &core.ProblemDetails{
-			Type:   core.UnauthorizedProblem,
-			Detail: "No certs presented for DVSNI challenge",
+			Type:   core.MalformedProblem,
+			Detail: "Identifier type for TLS-ALPN-01 was not DNS",
 		}
 		challenge.Status = core.StatusInvalid
+		va.log.Debug(fmt.Sprintf("TLS-ALPN-01 [%s] Identifier failure", identifier))
 		return challenge, challenge.Error
 	}
-	for _, name := range certs[0].DNSNames {
-		if subtle.ConstantTimeCompare([]byte(name), []byte(zName)) == 1 {
-			challenge.Status = core.StatusValid
-			return challenge, nil
+
+	// Check for DNSSEC failures, and enumerate every A/AAAA address for
+	// the identifier.
+	_, addrs, err := va.DNSResolver.LookupHost(identifier.Value)
+	if err != nil {
+		if dnssecErr, ok := err.(core.DNSSECError); ok {
+			challenge.Error = &core.ProblemDetails{
+				Type:   core.DNSSECProblem,
+				Detail: dnssecErr.Error(),
+			}
+		} else {
+			challenge.Error = &core.ProblemDetails{
+				Type:   core.ServerInternalProblem,
+				Detail: "Unable to communicate with DNS server",
+			}
 		}
+		challenge.Status = core.StatusInvalid
+		va.log.Debug(fmt.Sprintf("TLS-ALPN-01 [%s] DNS failure: %s", identifier, err))
+		return challenge, challenge.Error
 	}
 
-	challenge.Error = &core.ProblemDetails{
-		Type:   core.UnauthorizedProblem,
-		Detail: "Correct zName not found for DVSNI challenge",
+	if len(addrs) == 0 {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.ServerInternalProblem,
+			Detail: fmt.Sprintf("No addresses found for %s", identifier.Value),
+		}
+		return challenge, challenge.Error
 	}
-	challenge.Status = core.StatusInvalid
-	return challenge, challenge.Error
+
+	keyAuthorization, err := core.KeyAuthorization(challenge.Token, accountKey)
+	if err != nil {
+		challenge.Error = &core.ProblemDetails{
+			Type:   core.ServerInternalProblem,
+			Detail: "Unable to compute key authorization for TLS-ALPN-01 challenge",
+		}
+		challenge.Status = core.StatusInvalid
+		return challenge, err
+	}
+
+	// Dial every resolved address explicitly and require each one (or a
+	// configured quorum) to independently present a valid response,
+	// closing the well-known DV loophole where only one round-robin
+	// backend is compromised.
+	addressResults := make(map[string]string, len(addrs))
+	successes := 0
+	var lastErr error
+	for _, addr := range addrs {
+		verifyErr := va.verifyTLSALPN01Addr(identifier, addr, keyAuthorization)
+		if verifyErr != nil {
+			addressResults[addr.String()] = verifyErr.Error()
+			lastErr = verifyErr
+			continue
+		}
+		addressResults[addr.String()] = "valid"
+		successes++
+	}
+
+	va.log.AuditObject("TLS-ALPN-01 per-address results", addressValidationEvent{
+		Identifier:    identifier,
+		ChallengeType: core.ChallengeTypeTLSALPN01,
+		Results:       addressResults,
+	})
+
+	if successes < va.addressQuorum(len(addrs)) {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{
+			Type:   parseHTTPConnError(lastErr),
+			Detail: fmt.Sprintf("TLS-ALPN-01 validation failed for one or more addresses of %s: %s", identifier.Value, lastErr.Error()),
+		}
+		return challenge, challenge.Error
+	}
+
+	challenge.Status = core.StatusValid
+	return challenge, nil
+}
+
+// verifyTLSALPN01Addr dials addr directly (rather than identifier.Value, so
+// that every resolved address is independently exercised) and verifies the
+// presented certificate satisfies the TLS-ALPN-01 challenge: a negotiated
+// acme-tls/1 ALPN protocol, a self-signed certificate with exactly
+// identifier.Value as its sole dNSName SAN, and a critical acmeIdentifier
+// extension whose value is the SHA-256 digest of keyAuthorization.
+func (va *ValidationAuthorityImpl) verifyTLSALPN01Addr(identifier core.AcmeIdentifier, addr net.IP, keyAuthorization string) error {
+	hostPort := net.JoinHostPort(addr.String(), "443")
+	va.log.Notice(fmt.Sprintf("TLS-ALPN-01 [%s] Attempting to validate for %s", identifier, hostPort))
+	conn, err := va.dialTLS("tcp", hostPort, &tls.Config{
+		ServerName:         identifier.Value,
+		NextProtos:         []string{ACMETLS1Protocol},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("TLS-ALPN-01 [%s] TLS Connection failure: %s", identifier, err))
+		return err
+	}
+	defer conn.Close()
+
+	if conn.ConnectionState().NegotiatedProtocol != ACMETLS1Protocol {
+		return fmt.Errorf("Server did not negotiate acme-tls/1 for TLS-ALPN-01 challenge")
+	}
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("No certs presented for TLS-ALPN-01 challenge")
+	}
+	cert := certs[0]
+
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		return fmt.Errorf("Certificate presented for TLS-ALPN-01 was not self-signed")
+	}
+
+	if len(cert.DNSNames) != 1 || !strings.EqualFold(cert.DNSNames[0], identifier.Value) {
+		return fmt.Errorf("Incorrect validation certificate for TLS-ALPN-01 challenge: wrong dNSName SAN")
+	}
+
+	var ext *pkix.Extension
+	for i := range cert.Extensions {
+		if cert.Extensions[i].Id.Equal(idPeAcmeIdentifier) {
+			ext = &cert.Extensions[i]
+			break
+		}
+	}
+	if ext == nil {
+		return fmt.Errorf("Incorrect validation certificate for TLS-ALPN-01 challenge: missing acmeIdentifier extension")
+	}
+	if !ext.Critical {
+		return fmt.Errorf("Incorrect validation certificate for TLS-ALPN-01 challenge: acmeIdentifier extension not critical")
+	}
+
+	var extValue []byte
+	if rest, err := asn1.Unmarshal(ext.Value, &extValue); err != nil || len(rest) != 0 {
+		return fmt.Errorf("Incorrect validation certificate for TLS-ALPN-01 challenge: malformed acmeIdentifier extension")
+	}
+
+	expectedDigest := sha256.Sum256([]byte(keyAuthorization))
+	if subtle.ConstantTimeCompare(extValue, expectedDigest[:]) != 1 {
+		return fmt.Errorf("Incorrect validation certificate for TLS-ALPN-01 challenge: digest mismatch")
+	}
+
+	return nil
 }
 
 // parseHTTPConnError returns the ACME ProblemType corresponding to an error
@@ -391,7 +1070,7 @@ func parseHTTPConnError(err error) core.ProblemType {
 	return core.ConnectionProblem
 }
 
-func (va ValidationAuthorityImpl) validateDNS(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge, error) {
+func (va *ValidationAuthorityImpl) validateDNS(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge, error) {
 	challenge := input
 
 	if identifier.Type != core.IdentifierDNS {
@@ -444,41 +1123,47 @@ func (va ValidationAuthorityImpl) validateDNS(identifier core.AcmeIdentifier, in
 
 // Overall validation process
 
-func (va ValidationAuthorityImpl) validate(authz core.Authorization, challengeIndex int, accountKey jose.JsonWebKey) {
+// solve runs sanity checks and dispatches to the ChallengeSolver registered
+// for the challenge's type, returning the resulting challenge and any error
+// encountered along the way.
+func (va *ValidationAuthorityImpl) solve(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	if !challenge.IsSane(true) {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{Type: core.MalformedProblem,
+			Detail: fmt.Sprintf("Challenge failed sanity check.")}
+		return challenge, challenge.Error
+	}
 
-	// Select the first supported validation method
-	// XXX: Remove the "break" lines to process all supported validations
+	solver, ok := va.solvers[challenge.Type]
+	if !ok {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &core.ProblemDetails{Type: core.MalformedProblem,
+			Detail: fmt.Sprintf("Unable to solve challenge of type %s", challenge.Type)}
+		return challenge, challenge.Error
+	}
+
+	return solver.Solve(identifier, challenge, accountKey)
+}
+
+func (va *ValidationAuthorityImpl) validate(authz core.Authorization, challengeIndex int, accountKey jose.JsonWebKey) {
 	logEvent := verificationRequestEvent{
 		ID:          authz.ID,
 		Requester:   authz.RegistrationID,
 		RequestTime: time.Now(),
 	}
-	if !authz.Challenges[challengeIndex].IsSane(true) {
-		chall := &authz.Challenges[challengeIndex]
-		chall.Status = core.StatusInvalid
-		chall.Error = &core.ProblemDetails{Type: core.MalformedProblem,
-			Detail: fmt.Sprintf("Challenge failed sanity check.")}
-		logEvent.Challenge = *chall
-		logEvent.Error = chall.Error.Detail
-	} else {
-		var err error
 
-		switch authz.Challenges[challengeIndex].Type {
-		case core.ChallengeTypeSimpleHTTP:
-			authz.Challenges[challengeIndex], err = va.validateSimpleHTTP(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
-			break
-		case core.ChallengeTypeDVSNI:
-			authz.Challenges[challengeIndex], err = va.validateDvsni(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
-			break
-		case core.ChallengeTypeDNS:
-			authz.Challenges[challengeIndex], err = va.validateDNS(authz.Identifier, authz.Challenges[challengeIndex])
-			break
+	challenge, err := va.solve(authz.Identifier, authz.Challenges[challengeIndex], accountKey)
+	if err == nil && challenge.Status == core.StatusValid {
+		challenge, logEvent.PerspectiveResults = va.confirmWithRemotePerspectives(authz.Identifier, challenge, accountKey)
+		if challenge.Error != nil {
+			err = challenge.Error
 		}
+	}
+	authz.Challenges[challengeIndex] = challenge
 
-		logEvent.Challenge = authz.Challenges[challengeIndex]
-		if err != nil {
-			logEvent.Error = err.Error()
-		}
+	logEvent.Challenge = challenge
+	if err != nil {
+		logEvent.Error = err.Error()
 	}
 
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
@@ -489,11 +1174,71 @@ func (va ValidationAuthorityImpl) validate(authz core.Authorization, challengeIn
 	va.RA.OnValidationUpdate(authz)
 }
 
-func (va ValidationAuthorityImpl) UpdateValidations(authz core.Authorization, challengeIndex int, accountKey jose.JsonWebKey) error {
+func (va *ValidationAuthorityImpl) UpdateValidations(authz core.Authorization, challengeIndex int, accountKey jose.JsonWebKey) error {
 	go va.validate(authz, challengeIndex, accountKey)
 	return nil
 }
 
+// UpdateValidationsParallel attempts every challenge named in
+// challengeIndices concurrently, mirroring the "pre-solve" pattern used by
+// some ACME clients, and reports the authorization as valid as soon as the
+// first challenge succeeds. It is otherwise equivalent to UpdateValidations.
+func (va *ValidationAuthorityImpl) UpdateValidationsParallel(authz core.Authorization, challengeIndices []int, accountKey jose.JsonWebKey) error {
+	go va.validateParallel(authz, challengeIndices, accountKey)
+	return nil
+}
+
+func (va *ValidationAuthorityImpl) validateParallel(authz core.Authorization, challengeIndices []int, accountKey jose.JsonWebKey) {
+	type solveResult struct {
+		index     int
+		challenge core.Challenge
+		err       error
+	}
+
+	results := make(chan solveResult, len(challengeIndices))
+	for _, index := range challengeIndices {
+		go func(index int) {
+			challenge, err := va.solve(authz.Identifier, authz.Challenges[index], accountKey)
+			results <- solveResult{index: index, challenge: challenge, err: err}
+		}(index)
+	}
+
+	var firstValid *solveResult
+	for i := 0; i < len(challengeIndices); i++ {
+		result := <-results
+		authz.Challenges[result.index] = result.challenge
+		if result.err == nil && firstValid == nil {
+			r := result
+			firstValid = &r
+		}
+	}
+
+	logEvent := verificationRequestEvent{
+		ID:          authz.ID,
+		Requester:   authz.RegistrationID,
+		RequestTime: time.Now(),
+	}
+	if firstValid != nil {
+		challenge := firstValid.challenge
+		challenge, logEvent.PerspectiveResults = va.confirmWithRemotePerspectives(authz.Identifier, challenge, accountKey)
+		authz.Challenges[firstValid.index] = challenge
+		logEvent.Challenge = challenge
+		if challenge.Error != nil {
+			logEvent.Error = challenge.Error.Detail
+		}
+	} else if len(challengeIndices) > 0 {
+		logEvent.Challenge = authz.Challenges[challengeIndices[0]]
+		logEvent.Error = "No challenge validated successfully"
+	}
+
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	va.log.AuditObject("Validation result", logEvent)
+
+	va.log.Notice(fmt.Sprintf("Validations: %+v", authz))
+
+	va.RA.OnValidationUpdate(authz)
+}
+
 // CAASet consists of filtered CAA records
 type CAASet struct {
 	Issue     []*dns.CAA
@@ -537,10 +1282,24 @@ func newCAASet(CAAs []*dns.CAA) *CAASet {
 	return &filtered
 }
 
-func (va *ValidationAuthorityImpl) getCAASet(domain string, dnsResolver *core.DNSResolver) (*CAASet, error) {
-	domain = strings.TrimRight(domain, ".")
+// climbCAATree walks domain's tree from most to least specific label
+// (RFC 6844 CAA set query sequence, 'x.y.z.com' => ['x.y.z.com', 'y.z.com',
+// 'z.com']), returning the CAASet at the first level that has any CAA
+// RRset at all. Per RFC 6844/8659, the climb must stop there rather than
+// continuing to search higher: a level's issuewild/issue precedence is
+// resolved within that one RRset (by the caller, since only it knows
+// whether the identifier under check is a wildcard), not by skipping ahead
+// to a more permissive ancestor.
+//
+// At each level, CAA records are queried both directly and via alias=true,
+// which asks DNSResolver to also follow a CNAME at that name before
+// querying, per RFC 6844 section 5.1 — this is the same
+// LookupCAA(domain, alias) idiom the rest of the codebase already uses for
+// alias handling. DNSResolver has no equivalent DNAME-following lookup
+// today, so a DNAME redirecting a domain's entire subtree is not chased;
+// that's a narrower gap than the CNAME case this closes.
+func (va *ValidationAuthorityImpl) climbCAATree(domain string) (*CAASet, error) {
 	splitDomain := strings.Split(domain, ".")
-	// RFC 6844 CAA set query sequence, 'x.y.z.com' => ['x.y.z.com', 'y.z.com', 'z.com']
 	for i := range splitDomain {
 		queryDomain := strings.Join(splitDomain[i:], ".")
 		// Don't query a public suffix
@@ -548,28 +1307,84 @@ func (va *ValidationAuthorityImpl) getCAASet(domain string, dnsResolver *core.DN
 			break
 		}
 
-		// Query CAA records for domain and its alias if it has a CNAME
 		for _, alias := range []bool{false, true} {
 			CAAs, err := va.DNSResolver.LookupCAA(queryDomain, alias)
 			if err != nil {
 				return nil, err
 			}
-
 			if len(CAAs) > 0 {
 				return newCAASet(CAAs), nil
 			}
 		}
 	}
 
-	// no CAA records found
 	return nil, nil
 }
 
+// getCAASet climbs domain's CAA tree, stopping at the first RRset found;
+// issuewild-vs-issue precedence within that RRset is handled by the caller.
+func (va *ValidationAuthorityImpl) getCAASet(domain string) (*CAASet, error) {
+	domain = strings.TrimRight(domain, ".")
+	domain = strings.TrimPrefix(domain, "*.")
+
+	return va.climbCAATree(domain)
+}
+
+// caaParameters splits a CAA issue/issuewild property value into its
+// domain and its ";"-separated parameters (RFC 8657's account= and
+// validationmethods=), e.g. "ca.example.com; account=12345" =>
+// ("ca.example.com", map[account:12345]).
+func caaParameters(value string) (string, map[string]string) {
+	parts := strings.Split(value, ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return strings.TrimSpace(parts[0]), params
+}
+
+// CAACheckParameters narrows a CAA authorization check to a specific
+// account and challenge type, per the optional account= and
+// validationmethods= CAA parameters (RFC 8657). A nil *CAACheckParameters
+// matches any account or validation method.
+type CAACheckParameters struct {
+	AccountID     int64
+	ChallengeType string
+}
+
+func (p *CAACheckParameters) satisfiedBy(params map[string]string) bool {
+	if p == nil {
+		return true
+	}
+	if account, ok := params["account"]; ok && account != "" {
+		if account != fmt.Sprintf("%d", p.AccountID) {
+			return false
+		}
+	}
+	if methods, ok := params["validationmethods"]; ok && methods != "" {
+		matched := false
+		for _, method := range strings.Split(methods, ",") {
+			if strings.TrimSpace(method) == p.ChallengeType {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
 // CheckCAARecords verifies that, if the indicated subscriber domain has any CAA
-// records, they authorize the configured CA domain to issue a certificate
-func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifier) (present, valid bool, err error) {
+// records, they authorize the configured CA domain to issue a certificate,
+// optionally narrowed to a specific account/challenge type via params.
+func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifier, params *CAACheckParameters) (present, valid bool, err error) {
 	domain := strings.ToLower(identifier.Value)
-	caaSet, err := va.getCAASet(domain, va.DNSResolver)
+	caaSet, err := va.getCAASet(domain)
 	if err != nil {
 		return
 	}
@@ -585,19 +1400,29 @@ func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifie
 	} else if len(caaSet.Issue) > 0 || len(caaSet.Issuewild) > 0 {
 		present = true
 		var checkSet []*dns.CAA
-		if strings.SplitN(domain, ".", 2)[0] == "*" {
+		if strings.HasPrefix(domain, "*.") && len(caaSet.Issuewild) > 0 {
+			// Per RFC 8659 5.2, issuewild properties take precedence over
+			// issue properties for a wildcard name, but only within the
+			// RRset where they're found; if this RRset has none, its issue
+			// properties are used as though they were issuewild.
 			checkSet = caaSet.Issuewild
 		} else {
 			checkSet = caaSet.Issue
 		}
 		for _, caa := range checkSet {
-			if caa.Value == va.IssuerDomain {
-				valid = true
-				return
-			} else if caa.Flag > 0 {
-				valid = false
-				return
+			caaDomain, caaParams := caaParameters(caa.Value)
+			if caaDomain != va.IssuerDomain {
+				if caa.Flag > 0 {
+					valid = false
+					return
+				}
+				continue
+			}
+			if !params.satisfiedBy(caaParams) {
+				continue
 			}
+			valid = true
+			return
 		}
 
 		valid = false
@@ -606,3 +1431,35 @@ func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifie
 
 	return
 }
+
+// CAARecheckDuration is the default maximum age, per the CA/Browser Forum
+// Baseline Requirements, that a prior CAA check may be relied upon before
+// issuance. Callers with a stricter policy may pass a shorter maxAge to
+// RecheckCAA.
+const CAARecheckDuration = 8 * time.Hour
+
+// RecheckCAA re-verifies CAA for authz if its original CAA check, made at
+// checkedAt, is older than maxAge (typically CAARecheckDuration, but the RA
+// may supply a caller-specific maximum age). It returns a ProblemDetails if
+// CAA now forbids issuance, or nil if issuance may proceed.
+func (va *ValidationAuthorityImpl) RecheckCAA(authz core.Authorization, checkedAt time.Time, maxAge time.Duration, params *CAACheckParameters) error {
+	if time.Since(checkedAt) < maxAge {
+		return nil
+	}
+
+	present, valid, err := va.CheckCAARecords(authz.Identifier, params)
+	if err != nil {
+		return &core.ProblemDetails{
+			Type:   core.ServerInternalProblem,
+			Detail: fmt.Sprintf("Rechecking CAA for %s: %s", authz.Identifier.Value, err),
+		}
+	}
+	if present && !valid {
+		return &core.ProblemDetails{
+			Type:   core.UnauthorizedProblem,
+			Detail: fmt.Sprintf("CAA rechecked for %s and no longer authorizes issuance", authz.Identifier.Value),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// fakeRemoteVA is a RemoteVA stub whose verdict and latency are configured
+// by the test, so confirmWithRemotePerspectives's quorum and timeout logic
+// can be exercised without a real RPC round trip.
+type fakeRemoteVA struct {
+	perspective string
+	valid       bool
+	delay       time.Duration
+}
+
+func (r fakeRemoteVA) Perspective() string { return r.perspective }
+
+func (r fakeRemoteVA) PerformValidation(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return challenge, ctx.Err()
+	}
+	if r.valid {
+		challenge.Status = core.StatusValid
+		return challenge, nil
+	}
+	challenge.Status = core.StatusInvalid
+	return challenge, &core.ProblemDetails{Type: core.UnauthorizedProblem, Detail: "fake remote failure"}
+}
+
+// fakeSolver is a ChallengeSolver whose Solve result is configured by the
+// test, so the registry and fan-out logic can be exercised without driving
+// a real network validation.
+type fakeSolver struct {
+	challengeType string
+	valid         bool
+}
+
+func (s fakeSolver) Type() string { return s.challengeType }
+
+func (s fakeSolver) Solve(identifier core.AcmeIdentifier, challenge core.Challenge, accountKey jose.JsonWebKey) (core.Challenge, error) {
+	if s.valid {
+		challenge.Status = core.StatusValid
+		return challenge, nil
+	}
+	challenge.Status = core.StatusInvalid
+	challenge.Error = &core.ProblemDetails{Type: core.UnauthorizedProblem, Detail: "fake failure"}
+	return challenge, challenge.Error
+}
+
+// fakeRA is a minimal core.RegistrationAuthority stub, following the same
+// pattern as va/vatest's mockRA, that only records OnValidationUpdate
+// calls.
+type fakeRA struct {
+	core.RegistrationAuthority
+
+	mu   sync.Mutex
+	seen []core.Authorization
+}
+
+func (ra *fakeRA) OnValidationUpdate(authz core.Authorization) error {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	ra.seen = append(ra.seen, authz)
+	return nil
+}
+
+func (ra *fakeRA) authorizations() []core.Authorization {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	out := make([]core.Authorization, len(ra.seen))
+	copy(out, ra.seen)
+	return out
+}
+
+// TestRegisterSolverOverridesDispatch confirms that RegisterSolver replaces
+// whatever solver was previously registered for a challenge type, so
+// operators can swap in their own ChallengeSolver without touching solve's
+// dispatch logic.
+func TestRegisterSolverOverridesDispatch(t *testing.T) {
+	impl := NewValidationAuthorityImpl()
+
+	impl.RegisterSolver(fakeSolver{challengeType: core.ChallengeTypeDVSNI, valid: true})
+	solver, ok := impl.solvers[core.ChallengeTypeDVSNI]
+	if !ok {
+		t.Fatal("DVSNI solver not registered")
+	}
+	challenge, err := solver.Solve(core.AcmeIdentifier{}, core.Challenge{Type: core.ChallengeTypeDVSNI}, jose.JsonWebKey{})
+	if err != nil || challenge.Status != core.StatusValid {
+		t.Fatalf("expected overridden solver to report valid, got status=%s err=%v", challenge.Status, err)
+	}
+
+	impl.RegisterSolver(fakeSolver{challengeType: core.ChallengeTypeDVSNI, valid: false})
+	solver, ok = impl.solvers[core.ChallengeTypeDVSNI]
+	if !ok {
+		t.Fatal("DVSNI solver missing after re-registration")
+	}
+	challenge, err = solver.Solve(core.AcmeIdentifier{}, core.Challenge{Type: core.ChallengeTypeDVSNI}, jose.JsonWebKey{})
+	if err == nil || challenge.Status != core.StatusInvalid {
+		t.Fatalf("expected re-registered solver to report invalid, got status=%s err=%v", challenge.Status, err)
+	}
+}
+
+// TestValidateParallelFirstSuccess confirms UpdateValidationsParallel's
+// "pre-solve" semantics: every named challenge is attempted concurrently,
+// and the authorization is reported with the first one that validates,
+// mirroring how an ACME client that pre-solves several challenge types
+// expects the CA to behave.
+func TestValidateParallelFirstSuccess(t *testing.T) {
+	impl := NewValidationAuthorityImpl()
+	ra := &fakeRA{}
+	impl.RA = ra
+	impl.RegisterSolver(fakeSolver{challengeType: core.ChallengeTypeDVSNI, valid: false})
+	impl.RegisterSolver(fakeSolver{challengeType: core.ChallengeTypeSimpleHTTP, valid: true})
+
+	authz := core.Authorization{
+		ID:             "test-authz",
+		RegistrationID: 1,
+		Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"},
+		Challenges: []core.Challenge{
+			{Type: core.ChallengeTypeDVSNI, Status: core.StatusPending},
+			{Type: core.ChallengeTypeSimpleHTTP, Status: core.StatusPending},
+		},
+	}
+
+	if err := impl.UpdateValidationsParallel(authz, []int{0, 1}, jose.JsonWebKey{}); err != nil {
+		t.Fatalf("UpdateValidationsParallel returned error: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ra.authorizations()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reported := ra.authorizations()
+	if len(reported) != 1 {
+		t.Fatalf("expected exactly one OnValidationUpdate call, got %d", len(reported))
+	}
+	if reported[0].Challenges[1].Status != core.StatusValid {
+		t.Errorf("expected SimpleHTTP challenge to be valid, got %s", reported[0].Challenges[1].Status)
+	}
+}
+
+// TestConfirmWithRemotePerspectivesQuorum confirms that
+// confirmWithRemotePerspectives invalidates the challenge when fewer than
+// RemoteQuorum perspectives agree, and that a remote which never responds
+// is treated as a non-agreeing perspective rather than stalling the call,
+// since RemoteVATimeout bounds each perspective individually.
+func TestConfirmWithRemotePerspectivesQuorum(t *testing.T) {
+	impl := NewValidationAuthorityImpl()
+	impl.RemoteVATimeout = 50 * time.Millisecond
+	impl.RemoteQuorum = 2
+	impl.RemoteVAs = []RemoteVA{
+		fakeRemoteVA{perspective: "agrees-1", valid: true},
+		fakeRemoteVA{perspective: "disagrees", valid: false},
+		fakeRemoteVA{perspective: "hangs", valid: true, delay: time.Hour},
+	}
+
+	challenge := core.Challenge{Type: core.ChallengeTypeSimpleHTTP, Status: core.StatusValid}
+	start := time.Now()
+	result, perspectives := impl.confirmWithRemotePerspectives(core.AcmeIdentifier{}, challenge, jose.JsonWebKey{})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("confirmWithRemotePerspectives took %s, the hung remote's timeout did not bound the call", elapsed)
+	}
+	if result.Status != core.StatusInvalid {
+		t.Errorf("expected challenge to be invalidated by failed quorum, got %s", result.Status)
+	}
+	if len(perspectives) != 3 {
+		t.Errorf("expected a PerspectiveResult for every RemoteVA, got %d", len(perspectives))
+	}
+
+	impl.RemoteVAs = []RemoteVA{
+		fakeRemoteVA{perspective: "agrees-1", valid: true},
+		fakeRemoteVA{perspective: "agrees-2", valid: true},
+		fakeRemoteVA{perspective: "hangs", valid: true, delay: time.Hour},
+	}
+	challenge = core.Challenge{Type: core.ChallengeTypeSimpleHTTP, Status: core.StatusValid}
+	result, _ = impl.confirmWithRemotePerspectives(core.AcmeIdentifier{}, challenge, jose.JsonWebKey{})
+	if result.Status != core.StatusValid {
+		t.Errorf("expected challenge to remain valid once quorum is met, got %s", result.Status)
+	}
+}
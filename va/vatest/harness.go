@@ -0,0 +1,200 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package vatest provides an in-process test harness for the va package.
+// It stands up real HTTP-01, DVSNI, and TLS-ALPN-01 responders on ephemeral
+// ports, plus a DNS server that resolves every name to those responders,
+// and returns a va.ValidationAuthorityImpl wired up (via DNSResolver,
+// HTTPClient, and DialTLS) to reach them, so integration tests can exercise
+// the real validation code paths without relying on global state or magic
+// port numbers such as localhost:5001.
+package vatest
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/va"
+)
+
+// RecordedAuthorization captures one call to OnValidationUpdate, so tests
+// can assert on how the VA reported a challenge's outcome.
+type RecordedAuthorization struct {
+	Authz core.Authorization
+}
+
+// mockRA is a minimal core.RegistrationAuthority stub that only records
+// OnValidationUpdate calls; it exists purely to give the harness's VA
+// somewhere to report results.
+type mockRA struct {
+	core.RegistrationAuthority
+
+	mu             sync.Mutex
+	authorizations []RecordedAuthorization
+}
+
+func (ra *mockRA) OnValidationUpdate(authz core.Authorization) error {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	ra.authorizations = append(ra.authorizations, RecordedAuthorization{Authz: authz})
+	return nil
+}
+
+// CAServer is an in-process harness standing up HTTP-01, DVSNI, and
+// TLS-ALPN-01 responders and a va.ValidationAuthorityImpl configured to
+// reach them, regardless of the identifier being validated.
+type CAServer struct {
+	VA *va.ValidationAuthorityImpl
+
+	httpServer *httptest.Server
+	tlsCert    *tls.Certificate
+	tlsDomain  string
+	tlsConn    net.Listener
+
+	dnsConn   net.PacketConn
+	dnsServer *dns.Server
+
+	ra *mockRA
+
+	mu       sync.Mutex
+	requests []string
+}
+
+// New starts an HTTP-01 responder, a TLS responder used for both DVSNI and
+// TLS-ALPN-01 (the two are distinguished by SNI/ALPN, so one listener
+// suffices), and returns a CAServer with a VA pointed at both.
+//
+// tlsResponse, if non-nil, is consulted for the certificate to present on
+// each TLS connection; it lets tests serve the DVSNI or TLS-ALPN-01
+// certificate appropriate to the challenge under test.
+func New(handler http.Handler, tlsResponse func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*CAServer, error) {
+	s := &CAServer{ra: &mockRA{}}
+
+	s.httpServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.record(fmt.Sprintf("HTTP %s %s", r.Method, r.URL.Path))
+		handler.ServeHTTP(w, r)
+	}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	tlsListener := tls.NewListener(listener, &tls.Config{
+		GetCertificate: tlsResponse,
+		NextProtos:     []string{va.ACMETLS1Protocol},
+	})
+	s.tlsConn = tlsListener
+	go func() {
+		for {
+			conn, err := tlsListener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				if tlsConn, ok := c.(*tls.Conn); ok {
+					_ = tlsConn.Handshake()
+					s.record(fmt.Sprintf("TLS handshake from %s", c.RemoteAddr()))
+				}
+			}(conn)
+		}
+	}()
+
+	dnsConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s.dnsConn = dnsConn
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, r *dns.Msg) {
+		s.record(fmt.Sprintf("DNS %s %s", dns.TypeToString[r.Question[0].Qtype], r.Question[0].Name))
+		m := new(dns.Msg)
+		m.SetReply(r)
+		q := r.Question[0]
+		switch q.Qtype {
+		case dns.TypeA:
+			rr, _ := dns.NewRR(fmt.Sprintf("%s 0 IN A 127.0.0.1", q.Name))
+			m.Answer = append(m.Answer, rr)
+		case dns.TypeAAAA:
+			rr, _ := dns.NewRR(fmt.Sprintf("%s 0 IN AAAA ::1", q.Name))
+			m.Answer = append(m.Answer, rr)
+		}
+		_ = w.WriteMsg(m)
+	})
+	s.dnsServer = &dns.Server{PacketConn: dnsConn, Handler: mux}
+	go func() {
+		_ = s.dnsServer.ActivateAndServe()
+	}()
+
+	impl := va.NewValidationAuthorityImpl()
+	impl.RA = s.ra
+	impl.DNSResolver = core.NewDNSResolver(5*time.Second, []string{dnsConn.LocalAddr().String()})
+	impl.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			// Every request, regardless of the hostName the challenge
+			// targets, is redirected to the in-process HTTP-01 responder.
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial(network, s.httpServer.Listener.Addr().String())
+			},
+		},
+	}
+	impl.DialTLS = func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+		rawConn, err := net.Dial(network, s.tlsConn.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		clientConfig := config.Clone()
+		clientConfig.InsecureSkipVerify = true
+		conn := tls.Client(rawConn, clientConfig)
+		if err := conn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	s.VA = impl
+
+	return s, nil
+}
+
+// Close tears down the harness's listeners.
+func (s *CAServer) Close() {
+	s.httpServer.Close()
+	s.tlsConn.Close()
+	s.dnsServer.Shutdown()
+}
+
+// Requests returns the requests the harness has observed so far, in order.
+func (s *CAServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.requests))
+	copy(out, s.requests)
+	return out
+}
+
+// Authorizations returns the authorizations the harness's VA has reported
+// via OnValidationUpdate, in order.
+func (s *CAServer) Authorizations() []RecordedAuthorization {
+	s.ra.mu.Lock()
+	defer s.ra.mu.Unlock()
+	out := make([]RecordedAuthorization, len(s.ra.authorizations))
+	copy(out, s.ra.authorizations)
+	return out
+}
+
+func (s *CAServer) record(event string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, event)
+}
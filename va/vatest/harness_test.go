@@ -0,0 +1,96 @@
+// Copyright 2014 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package vatest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// selfSignedCert builds a throwaway self-signed certificate so the
+// harness's TLS responder has something to present; its contents don't
+// matter to this test, which only checks that a handshake completes.
+func selfSignedCert(t *testing.T) *tls.Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vatest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %s", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// TestNewReachesResponders confirms the harness's VA is actually wired to
+// the in-process responders it starts: DNSResolver must resolve a
+// never-before-seen name to a local address, HTTPClient must redirect
+// every request to the HTTP-01 responder regardless of the requested
+// host, and DialTLS must reach the TLS responder and negotiate
+// acme-tls/1.
+func TestNewReachesResponders(t *testing.T) {
+	cert := selfSignedCert(t)
+	s, err := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from the harness"))
+	}), func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cert, nil
+	})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	defer s.Close()
+
+	_, addrs, err := s.VA.DNSResolver.LookupHost("never-before-seen.example.com")
+	if err != nil {
+		t.Fatalf("DNSResolver.LookupHost: %s", err)
+	}
+	if len(addrs) == 0 {
+		t.Fatal("harness DNS resolver returned no addresses")
+	}
+
+	resp, err := s.VA.HTTPClient.Get("http://never-before-seen.example.com/.well-known/acme-challenge/x")
+	if err != nil {
+		t.Fatalf("HTTPClient.Get: %s", err)
+	}
+	defer resp.Body.Close()
+
+	found := false
+	for _, req := range s.Requests() {
+		if strings.HasPrefix(req, "HTTP GET") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("harness did not record an HTTP request, saw: %v", s.Requests())
+	}
+
+	conn, err := s.VA.DialTLS("tcp", "never-before-seen.example.com:443", &tls.Config{
+		ServerName: "never-before-seen.example.com",
+		NextProtos: []string{"acme-tls/1"},
+	})
+	if err != nil {
+		t.Fatalf("DialTLS: %s", err)
+	}
+	defer conn.Close()
+	if conn.ConnectionState().NegotiatedProtocol != "acme-tls/1" {
+		t.Errorf("expected acme-tls/1 to be negotiated, got %q", conn.ConnectionState().NegotiatedProtocol)
+	}
+}